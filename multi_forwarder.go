@@ -0,0 +1,324 @@
+package liveshare
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// A ForwardMode selects how a MultiForwarder distributes a single remote
+// port across the local listeners and streams registered with it.
+type ForwardMode int
+
+const (
+	// ModeRoundRobin runs every registered listener and stream
+	// concurrently, each forwarding its own connections to the remote
+	// port independently.
+	ModeRoundRobin ForwardMode = iota
+	// ModeFailover forwards through one registered sink at a time, falling
+	// through to the next if it errors or closes. Listeners are tried first,
+	// in registration order, then streams, in registration order.
+	ModeFailover
+	// ModeBroadcast opens a single channel to the remote port and mirrors
+	// its output to every registered stream and accepted connection,
+	// reading further input from the first registered stream or, if there
+	// are no streams, from the first connection any listener accepts.
+	ModeBroadcast
+)
+
+// A MultiForwarder shares a single remote port across multiple local
+// listeners and streams, sharing the port once and reusing the resulting
+// channel id for every streaming channel it opens. This is useful for
+// attaching more than one local consumer, such as a debugger and a log
+// tail, to the same forwarded container port.
+type MultiForwarder struct {
+	fwd  *PortForwarder
+	Mode ForwardMode
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	streams   []io.ReadWriteCloser
+}
+
+// NewMultiForwarder returns a new MultiForwarder for the specified remote
+// port and Live Share session. The name describes the purpose of the remote
+// port or service. The default mode is ModeRoundRobin.
+func NewMultiForwarder(session *Session, name string, remotePort int) *MultiForwarder {
+	return &MultiForwarder{
+		fwd:  NewPortForwarder(session, name, remotePort),
+		Mode: ModeRoundRobin,
+	}
+}
+
+// AddListener registers a local listener as a consumer of the forwarded
+// remote port. AddListener must be called before Start. As with
+// PortForwarder.ForwardToListener, the caller is responsible for closing
+// the listener to unblock Start once ctx is cancelled.
+func (m *MultiForwarder) AddListener(listen net.Listener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, listen)
+}
+
+// AddStream registers a read/write stream as a consumer of the forwarded
+// remote port. AddStream must be called before Start.
+func (m *MultiForwarder) AddStream(stream io.ReadWriteCloser) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streams = append(m.streams, stream)
+}
+
+// Start shares the remote port once, then forwards it to every registered
+// listener and stream according to m.Mode until ctx is cancelled. Unlike
+// PortForwarder, errors from individual sinks do not stop the others; they
+// are aggregated into the returned error.
+func (m *MultiForwarder) Start(ctx context.Context) error {
+	id, err := m.fwd.shareRemotePort(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	listeners := append([]net.Listener(nil), m.listeners...)
+	streams := append([]io.ReadWriteCloser(nil), m.streams...)
+	mode := m.Mode
+	m.mu.Unlock()
+
+	switch mode {
+	case ModeBroadcast:
+		return m.runBroadcast(ctx, id, listeners, streams)
+	case ModeFailover:
+		return m.runFailover(ctx, id, listeners, streams)
+	default:
+		return m.runRoundRobin(ctx, id, listeners, streams)
+	}
+}
+
+// runRoundRobin forwards every listener's accepted connections and every
+// stream concurrently, on independent streaming channels that share id.
+func (m *MultiForwarder) runRoundRobin(ctx context.Context, id channelID, listeners []net.Listener, streams []io.ReadWriteCloser) error {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		result *multierror.Error
+	)
+	addErr := func(err error) {
+		if err == nil {
+			return
+		}
+		mu.Lock()
+		result = multierror.Append(result, err)
+		mu.Unlock()
+	}
+
+	for _, listen := range listeners {
+		wg.Add(1)
+		go func(listen net.Listener) {
+			defer wg.Done()
+			addErr(m.acceptAndForward(ctx, id, listen, addErr))
+		}(listen)
+	}
+	for _, stream := range streams {
+		wg.Add(1)
+		go func(stream io.ReadWriteCloser) {
+			defer wg.Done()
+			addErr(m.fwd.handleConnection(ctx, id, stream))
+		}(stream)
+	}
+
+	wg.Wait()
+	return result.ErrorOrNil()
+}
+
+// acceptAndForward accepts connections from listen until it errors,
+// forwarding each one on its own streaming channel that shares id. As with
+// ForwardToListener, the caller must close listen to unblock Accept once ctx
+// is cancelled; acceptAndForward does not poll ctx itself. Errors from
+// individual forwarded connections are reported to addConnErr rather than
+// ending the accept loop.
+func (m *MultiForwarder) acceptAndForward(ctx context.Context, id channelID, listen net.Listener, addConnErr func(error)) error {
+	for {
+		conn, err := listen.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			addConnErr(m.fwd.handleConnection(ctx, id, conn))
+		}()
+	}
+}
+
+// runFailover forwards through the first registered sink only, falling
+// through to the next one in order if it errors, until one succeeds for the
+// lifetime of ctx or the sinks are exhausted. Errors from individual
+// forwarded connections on the active listener are aggregated alongside the
+// sinks' own failover errors, rather than being discarded.
+func (m *MultiForwarder) runFailover(ctx context.Context, id channelID, listeners []net.Listener, streams []io.ReadWriteCloser) error {
+	var (
+		mu     sync.Mutex
+		result *multierror.Error
+	)
+	addErr := func(err error) {
+		if err == nil {
+			return
+		}
+		mu.Lock()
+		result = multierror.Append(result, err)
+		mu.Unlock()
+	}
+
+	for _, listen := range listeners {
+		if err := m.acceptAndForward(ctx, id, listen, addErr); err != nil {
+			addErr(err)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		return nil
+	}
+	for _, stream := range streams {
+		if err := m.fwd.handleConnection(ctx, id, stream); err != nil {
+			addErr(err)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		return nil
+	}
+
+	return result.ErrorOrNil()
+}
+
+// A broadcastSink is a registered consumer of a MultiForwarder running in
+// ModeBroadcast, tagged with an id so it can be removed again if a write to
+// it fails.
+type broadcastSink struct {
+	id  int
+	rwc io.ReadWriteCloser
+}
+
+// runBroadcast opens a single streaming channel on id and mirrors its output
+// to every registered stream and listener's accepted connection, reading
+// further input from whichever of those is registered first (the first
+// stream, or if there are none, the first connection any listener accepts).
+func (m *MultiForwarder) runBroadcast(ctx context.Context, id channelID, listeners []net.Listener, streams []io.ReadWriteCloser) error {
+	channel, err := m.fwd.session.openStreamingChannel(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	var (
+		mu      sync.Mutex
+		sinks   []broadcastSink
+		nextID  int
+		primary io.ReadWriteCloser
+		result  *multierror.Error
+	)
+
+	addErr := func(err error) {
+		if err == nil {
+			return
+		}
+		mu.Lock()
+		result = multierror.Append(result, err)
+		mu.Unlock()
+	}
+
+	// addSink registers sink as a broadcast target. The first sink ever
+	// registered, from any source, becomes the primary: its input is
+	// copied into the remote channel.
+	addSink := func(sink io.ReadWriteCloser) {
+		mu.Lock()
+		nextID++
+		sinks = append(sinks, broadcastSink{id: nextID, rwc: sink})
+		becomePrimary := primary == nil
+		if becomePrimary {
+			primary = sink
+		}
+		mu.Unlock()
+
+		if becomePrimary {
+			go func() {
+				_, err := io.Copy(channel, sink)
+				addErr(ignoreEOF(err))
+			}()
+		}
+	}
+
+	removeSink := func(id int) {
+		mu.Lock()
+		for i, s := range sinks {
+			if s.id == id {
+				sinks = append(sinks[:i], sinks[i+1:]...)
+				break
+			}
+		}
+		mu.Unlock()
+	}
+
+	for _, stream := range streams {
+		addSink(stream)
+	}
+	for _, listen := range listeners {
+		go func(listen net.Listener) {
+			for {
+				conn, err := listen.Accept()
+				if err != nil {
+					addErr(err)
+					return
+				}
+				addSink(conn)
+			}
+		}(listen)
+	}
+
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := channel.Read(buf)
+			if n > 0 {
+				mu.Lock()
+				current := append([]broadcastSink(nil), sinks...)
+				mu.Unlock()
+
+				// Write to every sink concurrently, so one with a full send
+				// buffer doesn't hold up delivery to the others. A failing
+				// sink's error is aggregated and the sink is dropped.
+				var wg sync.WaitGroup
+				for _, sink := range current {
+					wg.Add(1)
+					go func(sink broadcastSink) {
+						defer wg.Done()
+						if _, werr := sink.rwc.Write(buf[:n]); werr != nil {
+							addErr(fmt.Errorf("broadcast write: %w", werr))
+							removeSink(sink.id)
+							sink.rwc.Close()
+						}
+					}(sink)
+				}
+				wg.Wait()
+			}
+			if err != nil {
+				addErr(ignoreEOF(err))
+				return
+			}
+		}
+	}()
+
+	<-ctx.Done()
+	return result.ErrorOrNil()
+}
+
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
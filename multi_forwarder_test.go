@@ -0,0 +1,114 @@
+package liveshare
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeMultiSession is a minimal sessionHandle double for MultiForwarder
+// tests: startSharing always succeeds immediately, and openStreamingChannel
+// returns whatever channel the test configured.
+type fakeMultiSession struct {
+	channel func() (io.ReadWriteCloser, error)
+}
+
+func (f *fakeMultiSession) startSharing(ctx context.Context, name string, remotePort int) (channelID, error) {
+	return channelID(1), nil
+}
+
+func (f *fakeMultiSession) openStreamingChannel(ctx context.Context, id channelID) (io.ReadWriteCloser, error) {
+	return f.channel()
+}
+
+func (f *fakeMultiSession) OnDisconnect(DisconnectListener) (unregister func()) {
+	return func() {}
+}
+
+// erroringRWC is an io.ReadWriteCloser whose Read always fails, for exercising
+// handleConnection's error path without a real network connection.
+type erroringRWC struct{ err error }
+
+func (e erroringRWC) Read([]byte) (int, error)  { return 0, e.err }
+func (erroringRWC) Write(p []byte) (int, error) { return len(p), nil }
+func (erroringRWC) Close() error                { return nil }
+
+func TestMultiForwarderBroadcastMirrorsToEverySink(t *testing.T) {
+	remote, remoteTest := net.Pipe()
+	defer remoteTest.Close()
+
+	m := &MultiForwarder{
+		fwd: &PortForwarder{
+			session:  &fakeMultiSession{channel: func() (io.ReadWriteCloser, error) { return remote, nil }},
+			name:     "test",
+			observer: noopObserver{},
+		},
+		Mode: ModeBroadcast,
+	}
+
+	sink1, testSink1 := net.Pipe()
+	sink2, testSink2 := net.Pipe()
+	defer sink1.Close()
+	defer sink2.Close()
+	defer testSink1.Close()
+	defer testSink2.Close()
+	m.AddStream(sink1)
+	m.AddStream(sink2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- m.Start(ctx) }()
+
+	// Give runBroadcast a moment to register both sinks before the remote
+	// side writes, since addSink is what subscribes them to the mirror.
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := remoteTest.Write([]byte("hello")); err != nil {
+		t.Fatalf("remoteTest.Write: %v", err)
+	}
+
+	for i, sink := range []net.Conn{testSink1, testSink2} {
+		buf := make([]byte, 5)
+		sink.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := io.ReadFull(sink, buf); err != nil {
+			t.Fatalf("sink %d: ReadFull: %v", i, err)
+		}
+		if string(buf) != "hello" {
+			t.Errorf("sink %d received %q, want %q", i, buf, "hello")
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Start = %v, want context.Canceled or nil", err)
+	}
+}
+
+func TestMultiForwarderFailoverFallsThroughToNextSink(t *testing.T) {
+	m := &MultiForwarder{
+		fwd: &PortForwarder{
+			session: &fakeMultiSession{channel: func() (io.ReadWriteCloser, error) {
+				return fakeRWC{Reader: strings.NewReader(""), Writer: io.Discard}, nil
+			}},
+			name:     "test",
+			observer: noopObserver{},
+		},
+		Mode: ModeFailover,
+	}
+
+	m.AddStream(erroringRWC{err: errors.New("boom")})
+	m.AddStream(fakeRWC{Reader: strings.NewReader(""), Writer: io.Discard})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := m.Start(ctx); err != nil {
+		t.Errorf("Start = %v, want nil once a later sink succeeds", err)
+	}
+}
@@ -0,0 +1,73 @@
+package liveshare
+
+import (
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Direction labels for PrometheusObserver's byte counter, from the
+// perspective of the local side of a forwarded connection.
+const (
+	directionIn  = "in"
+	directionOut = "out"
+)
+
+// A PrometheusObserver is a ConnectionObserver that reports forwarded
+// connection activity via Prometheus metrics: a gauge of connections
+// currently open, a counter of bytes transferred by direction, and a
+// histogram of how long opening a streaming channel takes.
+type PrometheusObserver struct {
+	ActiveConnections  prometheus.Gauge
+	BytesTotal         *prometheus.CounterVec
+	ChannelOpenSeconds prometheus.Histogram
+}
+
+// NewPrometheusObserver returns a PrometheusObserver with its metrics
+// constructed but not yet registered. Callers should register the metrics
+// returned by Collectors with a prometheus.Registerer to expose them.
+func NewPrometheusObserver() *PrometheusObserver {
+	return &PrometheusObserver{
+		ActiveConnections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "liveshare_forward_active_connections",
+			Help: "Number of forwarded connections currently open.",
+		}),
+		BytesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "liveshare_forward_bytes_total",
+			Help: "Total bytes transferred through forwarded connections, by direction.",
+		}, []string{"direction"}),
+		ChannelOpenSeconds: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "liveshare_forward_channel_open_duration_seconds",
+			Help: "Time taken to open the streaming channel for a forwarded connection.",
+		}),
+	}
+}
+
+// Collectors returns the observer's metrics, for registration with a
+// prometheus.Registerer (for example via prometheus.Registry.MustRegister).
+func (o *PrometheusObserver) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{o.ActiveConnections, o.BytesTotal, o.ChannelOpenSeconds}
+}
+
+// OnAccept implements ConnectionObserver.
+func (o *PrometheusObserver) OnAccept(remoteAddr net.Addr) {
+	o.ActiveConnections.Inc()
+}
+
+// OnChannelOpen implements ConnectionObserver.
+func (o *PrometheusObserver) OnChannelOpen(id channelID, dur time.Duration, err error) {
+	o.ChannelOpenSeconds.Observe(dur.Seconds())
+	if err != nil {
+		// OnClose is not called for a connection whose channel failed to
+		// open, so it is no longer counted as open here.
+		o.ActiveConnections.Dec()
+	}
+}
+
+// OnClose implements ConnectionObserver.
+func (o *PrometheusObserver) OnClose(id channelID, bytesIn, bytesOut int64, err error) {
+	o.BytesTotal.WithLabelValues(directionIn).Add(float64(bytesIn))
+	o.BytesTotal.WithLabelValues(directionOut).Add(float64(bytesOut))
+	o.ActiveConnections.Dec()
+}
@@ -2,28 +2,97 @@ package liveshare
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sync/atomic"
+	"time"
 )
 
 // A PortForwarder forwards TCP traffic over a LiveShare session from a port on a remote
 // container to a local destination such as a network port or Go reader/writer.
 type PortForwarder struct {
-	session    *Session
-	name       string
-	remotePort int
+	session     sessionHandle
+	name        string
+	remotePort  int
+	idleTimeout time.Duration
+	observer    ConnectionObserver
+}
+
+// sessionHandle is the subset of Session's behavior that PortForwarder
+// depends on. It exists as an interface, rather than PortForwarder holding a
+// *Session directly, so that tests can substitute a fake session without a
+// real transport.
+type sessionHandle interface {
+	startSharing(ctx context.Context, name string, remotePort int) (channelID, error)
+	openStreamingChannel(ctx context.Context, id channelID) (io.ReadWriteCloser, error)
+	OnDisconnect(listener DisconnectListener) (unregister func())
+}
+
+// A ConnectionObserver receives notifications about the lifecycle of
+// connections forwarded by a PortForwarder, for logging or metrics. Hook
+// implementations must be safe for concurrent use, since they may be called
+// from many forwarded connections at once.
+type ConnectionObserver interface {
+	// OnAccept is called for every connection handed to the forwarder,
+	// before a streaming channel has been opened for it. remoteAddr is nil
+	// if the connection doesn't expose one, as with a plain
+	// io.ReadWriteCloser passed to Forward.
+	OnAccept(remoteAddr net.Addr)
+	// OnChannelOpen is called once the streaming channel for a connection
+	// has been opened (or failed to open) on the session, reporting how
+	// long that took.
+	OnChannelOpen(id channelID, dur time.Duration, err error)
+	// OnClose is called once a forwarded connection has finished, reporting
+	// the total bytes copied in each direction and the error, if any, that
+	// ended the connection.
+	OnClose(id channelID, bytesIn, bytesOut int64, err error)
+}
+
+// WithConnectionObserver causes fwd to report the lifecycle of forwarded
+// connections to observer. If not set, a PortForwarder makes no such
+// reports.
+func WithConnectionObserver(observer ConnectionObserver) Option {
+	return func(fwd *PortForwarder) {
+		fwd.observer = observer
+	}
+}
+
+type noopObserver struct{}
+
+func (noopObserver) OnAccept(net.Addr)                             {}
+func (noopObserver) OnChannelOpen(channelID, time.Duration, error) {}
+func (noopObserver) OnClose(channelID, int64, int64, error)        {}
+
+// An Option configures optional PortForwarder behavior.
+type Option func(*PortForwarder)
+
+// WithIdleTimeout causes forwarded connections that exchange no data for
+// longer than d to be closed. This is important for quickly draining
+// forwards when a client disappears without closing its end, such as an SSH
+// client that receives SIGHUP. A zero duration, the default, disables the
+// idle timeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(fwd *PortForwarder) {
+		fwd.idleTimeout = d
+	}
 }
 
 // NewPortForwarder returns a new PortForwarder for the specified
 // remote port and Live Share session. The name describes the purpose
 // of the remote port or service.
-func NewPortForwarder(session *Session, name string, remotePort int) *PortForwarder {
-	return &PortForwarder{
+func NewPortForwarder(session *Session, name string, remotePort int, opts ...Option) *PortForwarder {
+	fwd := &PortForwarder{
 		session:    session,
 		name:       name,
 		remotePort: remotePort,
+		observer:   noopObserver{},
+	}
+	for _, opt := range opts {
+		opt(fwd)
 	}
+	return fwd
 }
 
 // ForwardToListener forwards traffic between the container's remote
@@ -92,7 +161,7 @@ func (fwd *PortForwarder) shareRemotePort(ctx context.Context) (channelID, error
 	if err != nil {
 		err = fmt.Errorf("failed to share remote port %d: %v", fwd.remotePort, err)
 	}
-	return id, nil
+	return id, err
 }
 
 func awaitError(ctx context.Context, errc <-chan error) error {
@@ -108,7 +177,11 @@ func awaitError(ctx context.Context, errc <-chan error) error {
 func (fwd *PortForwarder) handleConnection(ctx context.Context, id channelID, conn io.ReadWriteCloser) (err error) {
 	defer safeClose(conn, &err)
 
+	fwd.observer.OnAccept(remoteAddr(conn))
+
+	openStart := time.Now()
 	channel, err := fwd.session.openStreamingChannel(ctx, id)
+	fwd.observer.OnChannelOpen(id, time.Since(openStart), err)
 	if err != nil {
 		return fmt.Errorf("error opening streaming channel for new connection: %v", err)
 	}
@@ -122,14 +195,158 @@ func (fwd *PortForwarder) handleConnection(ctx context.Context, id channelID, co
 		}
 	}()
 
-	// Bi-directional copy of data.
-	// If any individual connection has an error, we can safely ignore them
-	// and defer to connection clients to handle data loss as necessary.
-	go io.Copy(conn, channel)
-	go io.Copy(channel, conn)
+	var bytesIn, bytesOut byteCounter
+	defer func() { fwd.observer.OnClose(id, bytesIn.total(), bytesOut.total(), err) }()
+
+	idleCtx, cancelIdle, connReader, channelReader := fwd.watchIdle(ctx, conn, channel)
+	defer cancelIdle()
+
+	// Bi-directional copy of data, each direction in its own goroutine so
+	// that one side finishing doesn't block the other. A clean EOF on a
+	// read half-closes the corresponding write half, so a peer that has
+	// stopped sending still gets to finish receiving.
+	done := make(chan error, 2)
+	go func() { done <- pumpClosingWrite(channel, &countingReader{connReader, &bytesOut}) }()
+	go func() { done <- pumpClosingWrite(conn, &countingReader{channelReader, &bytesIn}) }()
+
+	var errs []error
+	for remaining := 2; remaining > 0; {
+		select {
+		case copyErr := <-done:
+			remaining--
+			if copyErr != nil {
+				errs = append(errs, copyErr)
+				// A hard error on one side means its peer will never see
+				// more data; close both ends so the other copy unblocks
+				// instead of waiting on ctx.
+				conn.Close()
+				channel.Close()
+			}
+		case <-ctx.Done():
+			errs = append(errs, ctx.Err())
+			return errors.Join(errs...)
+		case <-idleCtx.Done():
+			// idleCtx is derived from ctx, so report a cancelled ctx as such
+			// rather than as an idle timeout.
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				errs = append(errs, ctxErr)
+			} else {
+				errs = append(errs, fmt.Errorf("connection idle for longer than %s", fwd.idleTimeout))
+			}
+			return errors.Join(errs...)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// remoteAddr returns conn's remote address if it has one (as a net.Conn
+// does), and nil otherwise, since handleConnection's conn is only required
+// to be an io.ReadWriteCloser.
+func remoteAddr(conn io.ReadWriteCloser) net.Addr {
+	if c, ok := conn.(interface{ RemoteAddr() net.Addr }); ok {
+		return c.RemoteAddr()
+	}
+	return nil
+}
+
+// pumpClosingWrite copies from src to dst until src returns a read error. On
+// a clean EOF it calls CloseWrite on dst, if dst supports half-closing,
+// so the peer observes that no more data is coming rather than having the
+// whole connection torn down.
+func pumpClosingWrite(dst io.Writer, src io.Reader) error {
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		if err := cw.CloseWrite(); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+// A byteCounter tallies bytes seen by a countingReader, for
+// reporting to a ConnectionObserver.
+type byteCounter struct {
+	n atomic.Int64
+}
+
+func (c *byteCounter) add(n int) {
+	if n > 0 {
+		c.n.Add(int64(n))
+	}
+}
+
+func (c *byteCounter) total() int64 {
+	return c.n.Load()
+}
+
+// A countingReader wraps an io.Reader, tallying every byte read into a
+// byteCounter.
+type countingReader struct {
+	io.Reader
+	counter *byteCounter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.counter.add(n)
+	return n, err
+}
+
+// watchIdle returns a context that is cancelled once no bytes have been read
+// from conn or channel for longer than fwd.idleTimeout, along with readers
+// wrapping conn and channel that track that activity. If fwd.idleTimeout is
+// zero, the idle timeout is disabled: the returned context is only ever
+// cancelled by ctx itself, and conn and channel are returned unwrapped.
+func (fwd *PortForwarder) watchIdle(ctx context.Context, conn, channel io.ReadWriteCloser) (idleCtx context.Context, cancel context.CancelFunc, connReader, channelReader io.Reader) {
+	idleCtx, cancel = context.WithCancel(ctx)
+	if fwd.idleTimeout <= 0 {
+		return idleCtx, cancel, conn, channel
+	}
+
+	activity := new(atomic.Int64)
+	touch(activity)
+	connReader = &activityReader{conn, activity}
+	channelReader = &activityReader{channel, activity}
+
+	go func() {
+		ticker := time.NewTicker(fwd.idleTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-idleCtx.Done():
+				return
+			case <-ticker.C:
+				if time.Since(time.Unix(0, activity.Load())) > fwd.idleTimeout {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return idleCtx, cancel, connReader, channelReader
+}
+
+// An activityReader wraps an io.Reader, recording the time of its most
+// recent successful read so an idle watcher can detect inactivity.
+type activityReader struct {
+	io.Reader
+	activity *atomic.Int64
+}
+
+func (r *activityReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		touch(r.activity)
+	}
+	return n, err
+}
 
-	<-ctx.Done()
-	return ctx.Err()
+func touch(activity *atomic.Int64) {
+	activity.Store(time.Now().UnixNano())
 }
 
 // safeClose reports the error (to *err) from closing the stream only
@@ -0,0 +1,97 @@
+package liveshare
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// closeWriteRecorder is an io.Writer that also implements CloseWrite, so
+// pumpClosingWrite can be tested as if writing to a half-closable
+// connection.
+type closeWriteRecorder struct {
+	io.Writer
+	closed bool
+}
+
+func (w *closeWriteRecorder) CloseWrite() error {
+	w.closed = true
+	return nil
+}
+
+type erroringReader struct{ err error }
+
+func (r *erroringReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestPumpClosingWriteCallsCloseWriteOnCleanEOF(t *testing.T) {
+	var buf strings.Builder
+	dst := &closeWriteRecorder{Writer: &buf}
+
+	if err := pumpClosingWrite(dst, strings.NewReader("hello")); err != nil {
+		t.Fatalf("pumpClosingWrite: %v", err)
+	}
+	if buf.String() != "hello" {
+		t.Errorf("copied %q, want %q", buf.String(), "hello")
+	}
+	if !dst.closed {
+		t.Error("expected CloseWrite to be called on a clean EOF")
+	}
+}
+
+func TestPumpClosingWriteReturnsHardErrorWithoutClosing(t *testing.T) {
+	dst := &closeWriteRecorder{Writer: io.Discard}
+	wantErr := errors.New("boom")
+
+	err := pumpClosingWrite(dst, &erroringReader{err: wantErr})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("err = %v, want %v", err, wantErr)
+	}
+	if dst.closed {
+		t.Error("CloseWrite should not be called after a hard read error")
+	}
+}
+
+func TestCountingReaderTallies(t *testing.T) {
+	var counter byteCounter
+	r := &countingReader{Reader: strings.NewReader("hello world"), counter: &counter}
+
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatalf("io.Copy: %v", err)
+	}
+	if got, want := counter.total(), int64(len("hello world")); got != want {
+		t.Errorf("counter.total() = %d, want %d", got, want)
+	}
+}
+
+// fakeRWC is a minimal io.ReadWriteCloser with no RemoteAddr method.
+type fakeRWC struct {
+	io.Reader
+	io.Writer
+}
+
+func (fakeRWC) Close() error { return nil }
+
+// fakeConn additionally implements RemoteAddr, as a net.Conn would.
+type fakeConn struct {
+	fakeRWC
+	addr net.Addr
+}
+
+func (c fakeConn) RemoteAddr() net.Addr { return c.addr }
+
+func TestRemoteAddrWithoutRemoteAddrMethod(t *testing.T) {
+	if addr := remoteAddr(fakeRWC{}); addr != nil {
+		t.Errorf("remoteAddr = %v, want nil", addr)
+	}
+}
+
+func TestRemoteAddrDelegatesToConn(t *testing.T) {
+	want := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1234}
+	conn := fakeConn{addr: want}
+
+	if got := remoteAddr(conn); got != want {
+		t.Errorf("remoteAddr = %v, want %v", got, want)
+	}
+}
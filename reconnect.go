@@ -0,0 +1,164 @@
+package liveshare
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// A Backoff computes how long to wait before the nth retry (n == 0 for the
+// first retry) of some failing operation.
+type Backoff interface {
+	Next(attempt int) time.Duration
+}
+
+// ExponentialBackoff is a Backoff that doubles its delay on each attempt, up
+// to Max.
+type ExponentialBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Next implements Backoff.
+func (b ExponentialBackoff) Next(attempt int) time.Duration {
+	d := b.Base
+	for i := 0; i < attempt; i++ {
+		d *= 2
+		if d >= b.Max {
+			return b.Max
+		}
+	}
+	if d > b.Max {
+		return b.Max
+	}
+	return d
+}
+
+// DefaultBackoff is the Backoff used by ForwardWithReconnect when none is
+// given.
+var DefaultBackoff Backoff = ExponentialBackoff{Base: 500 * time.Millisecond, Max: 30 * time.Second}
+
+// ForwardWithReconnect is like ForwardToListener, except that if the
+// session's transport is lost (as reported by the session's
+// OnDisconnect listeners, see Session.KeepAlive), it retries sharing the
+// remote port with backoff and resumes forwarding new connections on a
+// fresh channel, rather than returning an error. Connections accepted
+// before the transport was lost are dropped; callers handle the resulting
+// data loss. ForwardWithReconnect only returns once ctx is cancelled or the
+// listener itself errors. If backoff is nil, DefaultBackoff is used.
+func (fwd *PortForwarder) ForwardWithReconnect(ctx context.Context, listen net.Listener, backoff Backoff) error {
+	if backoff == nil {
+		backoff = DefaultBackoff
+	}
+
+	current := newCurrentChannel()
+	errc := make(chan error, 1)
+	sendError := func(err error) {
+		select {
+		case errc <- err:
+		default:
+		}
+	}
+
+	go fwd.reconnectLoop(ctx, backoff, current, sendError)
+
+	go func() {
+		// Wait for the first successful share before accepting any
+		// connections: until then, current has no channel id or
+		// generation context to hand them, and ctx is nil until
+		// current.set is called.
+		select {
+		case <-current.ready:
+		case <-ctx.Done():
+			return
+		}
+
+		for {
+			conn, err := listen.Accept()
+			if err != nil {
+				sendError(err)
+				return
+			}
+
+			id, genCtx := current.get()
+			go func() {
+				_ = fwd.handleConnection(genCtx, id, conn)
+			}()
+		}
+	}()
+
+	return awaitError(ctx, errc)
+}
+
+// reconnectLoop repeatedly shares the remote port, publishes the resulting
+// channel id to current, and waits for either ctx to be cancelled or the
+// session to report a disconnect, in which case it retries with backoff.
+func (fwd *PortForwarder) reconnectLoop(ctx context.Context, backoff Backoff, current *currentChannel, sendError func(error)) {
+	for attempt := 0; ; attempt++ {
+		genCtx, cancelGen := context.WithCancel(ctx)
+
+		id, err := fwd.shareRemotePort(genCtx)
+		if err != nil {
+			cancelGen()
+			select {
+			case <-ctx.Done():
+				sendError(ctx.Err())
+				return
+			case <-time.After(backoff.Next(attempt)):
+				continue
+			}
+		}
+		attempt = -1 // reset backoff after a successful (re)connect
+
+		disconnected := make(chan error, 1)
+		unregister := fwd.session.OnDisconnect(func(err error) {
+			select {
+			case disconnected <- err:
+			default:
+			}
+		})
+
+		current.set(id, genCtx)
+
+		select {
+		case <-ctx.Done():
+			unregister()
+			cancelGen()
+			return
+		case <-disconnected:
+			unregister()
+			cancelGen() // drop in-flight connections from this generation
+		}
+	}
+}
+
+// currentChannel holds the channel id and generation context that newly
+// accepted connections should use, updated each time ForwardWithReconnect
+// reconnects after a lost transport. ready is closed the first time set is
+// called, so that callers needing a valid id and ctx (rather than the
+// zero values present before the first share succeeds) can wait on it.
+type currentChannel struct {
+	mu    sync.Mutex
+	id    channelID
+	ctx   context.Context
+	ready chan struct{}
+	once  sync.Once
+}
+
+func newCurrentChannel() *currentChannel {
+	return &currentChannel{ready: make(chan struct{})}
+}
+
+func (c *currentChannel) set(id channelID, ctx context.Context) {
+	c.mu.Lock()
+	c.id, c.ctx = id, ctx
+	c.mu.Unlock()
+	c.once.Do(func() { close(c.ready) })
+}
+
+func (c *currentChannel) get() (channelID, context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.id, c.ctx
+}
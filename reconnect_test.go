@@ -0,0 +1,90 @@
+package liveshare
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeReconnectSession is a sessionHandle double that lets tests control how
+// long startSharing takes and simulate the transport disconnecting, without
+// a real LiveShare transport.
+type fakeReconnectSession struct {
+	shareDelay time.Duration
+
+	mu        sync.Mutex
+	listeners []DisconnectListener
+}
+
+func (f *fakeReconnectSession) startSharing(ctx context.Context, name string, remotePort int) (channelID, error) {
+	select {
+	case <-time.After(f.shareDelay):
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	return channelID(1), nil
+}
+
+func (f *fakeReconnectSession) openStreamingChannel(ctx context.Context, id channelID) (io.ReadWriteCloser, error) {
+	return fakeRWC{Reader: strings.NewReader(""), Writer: io.Discard}, nil
+}
+
+func (f *fakeReconnectSession) OnDisconnect(listener DisconnectListener) (unregister func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listeners = append(f.listeners, listener)
+	index := len(f.listeners) - 1
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.listeners[index] = nil
+	}
+}
+
+// TestForwardWithReconnectDoesNotDispatchBeforeFirstShare reproduces a
+// connection arriving while the very first shareRemotePort call is still in
+// flight: before current.ready is published, handing it to handleConnection
+// with a nil generation context would panic inside watchIdle's
+// context.WithCancel.
+func TestForwardWithReconnectDoesNotDispatchBeforeFirstShare(t *testing.T) {
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer listen.Close()
+
+	// Queue a connection in the listener's backlog before ForwardWithReconnect
+	// ever calls Accept, so it's waiting there the instant the accept loop
+	// starts.
+	dialDone := make(chan struct{})
+	go func() {
+		conn, err := net.Dial("tcp", listen.Addr().String())
+		close(dialDone)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Read(make([]byte, 1)) // wait for the peer to close its write half
+	}()
+	<-dialDone
+
+	fwd := &PortForwarder{
+		session:    &fakeReconnectSession{shareDelay: 50 * time.Millisecond},
+		name:       "test",
+		remotePort: 1234,
+		observer:   noopObserver{},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	// A panic here (e.g. "cannot create context from nil parent") would crash
+	// the whole test binary, not just fail this test.
+	if err := fwd.ForwardWithReconnect(ctx, listen, nil); err != ctx.Err() {
+		t.Errorf("ForwardWithReconnect = %v, want %v", err, ctx.Err())
+	}
+}
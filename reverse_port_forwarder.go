@@ -0,0 +1,141 @@
+package liveshare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// maxPendingReverseDials bounds the number of channel-open requests a
+// ReversePortForwarder handles at once, each holding its slot from the local
+// dial until the forwarded connection finishes. Additional channel-open
+// requests from the remote peer are rejected until a slot frees up, rather
+// than being queued indefinitely.
+const maxPendingReverseDials = 16
+
+// An incomingChannel is a channel-open request from the remote peer of a
+// session, awaiting a decision to Accept or Reject it.
+type incomingChannel interface {
+	Accept() (io.ReadWriteCloser, error)
+	Reject(reason, message string) error
+}
+
+// A ReversePortForwarder exposes a local TCP service to a LiveShare session's
+// remote container, the mirror image of PortForwarder: instead of forwarding a
+// remote port to a local destination, it forwards connections the remote peer
+// opens against a named listener to a port on localhost.
+type ReversePortForwarder struct {
+	session   *Session
+	name      string
+	localPort int
+}
+
+// NewReverseForwarder returns a new ReversePortForwarder that dials localPort
+// for every connection the remote peer opens against name.
+func NewReverseForwarder(session *Session, name string, localPort int) *ReversePortForwarder {
+	return &ReversePortForwarder{
+		session:   session,
+		name:      name,
+		localPort: localPort,
+	}
+}
+
+// Start registers a remote listener for fwd.name and begins dialing
+// fwd.localPort for each channel-open request the remote peer sends for it,
+// pumping bytes between the local connection and the channel until ctx is
+// cancelled or the returned close function is called. The returned function
+// tears down the remote listener and must be called once the caller is done
+// forwarding.
+func (fwd *ReversePortForwarder) Start(ctx context.Context) (stop func(), err error) {
+	id, err := fwd.session.startReverseSharing(ctx, fwd.name, fwd.localPort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register reverse listener for port %d: %v", fwd.localPort, err)
+	}
+
+	incoming, err := fwd.session.acceptChannels(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept channels for reverse listener %d: %v", fwd.localPort, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sem := make(chan struct{}, maxPendingReverseDials)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case req, ok := <-incoming:
+				if !ok {
+					return
+				}
+				select {
+				case sem <- struct{}{}:
+					go func() {
+						defer func() { <-sem }()
+						fwd.handleChannelRequest(ctx, req)
+					}()
+				default:
+					req.Reject("resource-shortage", "too many pending reverse connections")
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		fwd.session.stopSharing(id)
+	}, nil
+}
+
+// handleChannelRequest dials the local port for a single channel-open
+// request, rejecting it if the dial fails, and otherwise pumps bytes between
+// the local connection and the accepted channel using the same
+// half-close-aware, completion-signalling pump as PortForwarder.handleConnection,
+// so the connection (and its semaphore slot in Start) is freed as soon as
+// the copy finishes rather than when the whole forwarder is torn down.
+func (fwd *ReversePortForwarder) handleChannelRequest(ctx context.Context, req incomingChannel) (err error) {
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", fwd.localPort))
+	if err != nil {
+		req.Reject("connect-failed", err.Error())
+		return err
+	}
+	defer safeClose(conn, &err)
+
+	channel, err := req.Accept()
+	if err != nil {
+		return err
+	}
+	// See the matching comment in PortForwarder.handleConnection about
+	// (*ssh.channel).Close spuriously returning io.EOF.
+	defer func() {
+		closeErr := channel.Close()
+		if err == nil && closeErr != io.EOF {
+			err = closeErr
+		}
+	}()
+
+	done := make(chan error, 2)
+	go func() { done <- pumpClosingWrite(channel, conn) }()
+	go func() { done <- pumpClosingWrite(conn, channel) }()
+
+	var errs []error
+	for remaining := 2; remaining > 0; {
+		select {
+		case copyErr := <-done:
+			remaining--
+			if copyErr != nil {
+				errs = append(errs, copyErr)
+				conn.Close()
+				channel.Close()
+			}
+		case <-ctx.Done():
+			errs = append(errs, ctx.Err())
+			return errors.Join(errs...)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,97 @@
+package liveshare
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A DisconnectListener is notified when a Session's transport is found to be
+// unresponsive and has been closed as a result.
+type DisconnectListener func(err error)
+
+// KeepAlive sends a keepalive@openssh.com global request on the session's
+// transport every interval. If a request goes unanswered for longer than
+// timeout, the transport is considered stalled: it is closed and any
+// listeners registered with OnDisconnect are notified. KeepAlive does not
+// block; it returns a function that stops sending keepalives.
+func (s *Session) KeepAlive(interval, timeout time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := s.sendKeepAlive(timeout, done); err != nil {
+					s.disconnect(fmt.Errorf("keepalive: %v", err))
+					return
+				}
+			}
+		}
+	}()
+
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// sendKeepAlive sends a single keepalive request and waits up to timeout for
+// a reply, returning an error if the request fails or no reply arrives in
+// time. It returns nil if done is closed first.
+func (s *Session) sendKeepAlive(timeout time.Duration, done <-chan struct{}) error {
+	replyc := make(chan error, 1)
+	go func() {
+		_, _, err := s.conn.SendRequest("keepalive@openssh.com", true, nil)
+		replyc <- err
+	}()
+
+	select {
+	case err := <-replyc:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("no response within %s", timeout)
+	case <-done:
+		return nil
+	}
+}
+
+// disconnect closes the session's transport and notifies any listeners
+// registered with OnDisconnect.
+func (s *Session) disconnect(err error) {
+	s.mu.Lock()
+	listeners := make([]DisconnectListener, len(s.disconnectListeners))
+	copy(listeners, s.disconnectListeners)
+	s.mu.Unlock()
+
+	s.closeTransport()
+
+	for _, listener := range listeners {
+		if listener != nil {
+			listener(err)
+		}
+	}
+}
+
+// OnDisconnect registers a listener to be called if the session's transport
+// is later closed by KeepAlive after a keepalive request fails or times out.
+// It returns a function that
+// unregisters the listener.
+func (s *Session) OnDisconnect(listener DisconnectListener) (unregister func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.disconnectListeners = append(s.disconnectListeners, listener)
+	index := len(s.disconnectListeners) - 1
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if index < len(s.disconnectListeners) {
+			s.disconnectListeners[index] = nil
+		}
+	}
+}
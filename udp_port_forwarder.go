@@ -0,0 +1,272 @@
+package liveshare
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// defaultUDPIdleTimeout is how long a UDP flow may go without a datagram in
+// either direction before its connection table entry is evicted.
+const defaultUDPIdleTimeout = 2 * time.Minute
+
+const (
+	udpAddrFamilyIPv4 byte = 4
+	udpAddrFamilyIPv6 byte = 6
+)
+
+// A UDPPortForwarder forwards UDP datagrams over a LiveShare session from a
+// port on a remote container to a local destination, multiplexing every flow
+// over a single streaming channel instead of opening one channel per flow.
+// This mirrors the udpgw interception pattern used to tunnel UDP (notably
+// DNS) over what is otherwise a stream-oriented transport.
+type UDPPortForwarder struct {
+	session     *Session
+	name        string
+	remotePort  int
+	idleTimeout time.Duration
+}
+
+// NewUDPPortForwarder returns a new UDPPortForwarder for the specified
+// remote port and Live Share session. The name describes the purpose of the
+// remote port or service.
+func NewUDPPortForwarder(session *Session, name string, remotePort int) *UDPPortForwarder {
+	return &UDPPortForwarder{
+		session:     session,
+		name:        name,
+		remotePort:  remotePort,
+		idleTimeout: defaultUDPIdleTimeout,
+	}
+}
+
+// ForwardUDPToPacketConn forwards datagrams between the container's remote
+// UDP port and conn until the context is cancelled. Each distinct peer
+// talking to conn is tracked as a flow in a connection table and assigned a
+// short connection id, so that all flows can share the one streaming
+// channel. The caller is responsible for closing conn.
+func (fwd *UDPPortForwarder) ForwardUDPToPacketConn(ctx context.Context, conn net.PacketConn) error {
+	id, err := fwd.session.startSharing(ctx, fwd.name, fwd.remotePort)
+	if err != nil {
+		return fmt.Errorf("failed to share remote port %d: %v", fwd.remotePort, err)
+	}
+
+	channel, err := fwd.session.openStreamingChannel(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error opening streaming channel for udp forwarding: %v", err)
+	}
+	defer channel.Close()
+
+	table := newUDPConnTable(fwd.idleTimeout)
+	defer table.Close()
+
+	errc := make(chan error, 2)
+	go func() { errc <- fwd.readFromLocal(conn, channel, table) }()
+	go func() { errc <- fwd.readFromChannel(conn, channel, table) }()
+
+	return awaitError(ctx, errc)
+}
+
+// readFromLocal reads datagrams from conn and writes them to channel, each
+// framed with the originating peer's id and address.
+func (fwd *UDPPortForwarder) readFromLocal(conn net.PacketConn, channel io.ReadWriteCloser, table *udpConnTable) error {
+	buf := make([]byte, 64*1024)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		udpPeer, ok := peer.(*net.UDPAddr)
+		if !ok {
+			udpPeer, err = net.ResolveUDPAddr("udp", peer.String())
+			if err != nil {
+				continue
+			}
+		}
+
+		id := table.idFor(udpPeer)
+		if err := writeUDPFrame(channel, id, udpPeer, buf[:n]); err != nil {
+			return err
+		}
+	}
+}
+
+// readFromChannel reads framed datagrams from channel and writes their
+// payload back to the local peer identified by the frame's connection id.
+func (fwd *UDPPortForwarder) readFromChannel(conn net.PacketConn, channel io.ReadWriteCloser, table *udpConnTable) error {
+	for {
+		id, payload, err := readUDPFrame(channel)
+		if err != nil {
+			return err
+		}
+
+		peer, ok := table.addrFor(id)
+		if !ok {
+			// Unknown or evicted connection id; drop the datagram.
+			continue
+		}
+
+		if _, err := conn.WriteTo(payload, peer); err != nil {
+			return err
+		}
+	}
+}
+
+// writeUDPFrame writes a single length-prefixed datagram frame to w:
+// a 2-byte big-endian length, a 2-byte connection id, a 1-byte address
+// family, the address's IP bytes, a 2-byte port, then the payload.
+func writeUDPFrame(w io.Writer, id uint16, addr *net.UDPAddr, payload []byte) error {
+	ip := addr.IP.To4()
+	family := udpAddrFamilyIPv4
+	if ip == nil {
+		ip = addr.IP.To16()
+		family = udpAddrFamilyIPv6
+	}
+
+	header := make([]byte, 2+1+len(ip)+2)
+	binary.BigEndian.PutUint16(header[0:2], id)
+	header[2] = family
+	copy(header[3:3+len(ip)], ip)
+	binary.BigEndian.PutUint16(header[3+len(ip):], uint16(addr.Port))
+
+	frame := make([]byte, 2+len(header)+len(payload))
+	binary.BigEndian.PutUint16(frame[0:2], uint16(len(header)+len(payload)))
+	copy(frame[2:], header)
+	copy(frame[2+len(header):], payload)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// readUDPFrame reads and decodes a single frame written by writeUDPFrame.
+func readUDPFrame(r io.Reader) (id uint16, payload []byte, err error) {
+	var lenBuf [2]byte
+	if _, err = io.ReadFull(r, lenBuf[:]); err != nil {
+		return 0, nil, err
+	}
+
+	body := make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+	if _, err = io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	if len(body) < 3 {
+		return 0, nil, fmt.Errorf("udp frame too short: %d bytes", len(body))
+	}
+
+	id = binary.BigEndian.Uint16(body[0:2])
+	family := body[2]
+
+	var ipLen int
+	switch family {
+	case udpAddrFamilyIPv4:
+		ipLen = net.IPv4len
+	case udpAddrFamilyIPv6:
+		ipLen = net.IPv6len
+	default:
+		return 0, nil, fmt.Errorf("unsupported udp address family %d", family)
+	}
+	if len(body) < 3+ipLen+2 {
+		return 0, nil, fmt.Errorf("udp frame too short: %d bytes", len(body))
+	}
+
+	return id, body[3+ipLen+2:], nil
+}
+
+// udpConnTable tracks the local peers of a forwarded UDP socket, assigning
+// each a short-lived connection id so datagrams for many peers can share a
+// single streaming channel. Entries that see no traffic for idleTimeout are
+// evicted by a background goroutine.
+type udpConnTable struct {
+	idleTimeout time.Duration
+	done        chan struct{}
+
+	mu     sync.Mutex
+	nextID uint16
+	byAddr map[string]*udpConnEntry
+	byID   map[uint16]*udpConnEntry
+}
+
+type udpConnEntry struct {
+	id       uint16
+	addr     *net.UDPAddr
+	lastUsed time.Time
+}
+
+func newUDPConnTable(idleTimeout time.Duration) *udpConnTable {
+	t := &udpConnTable{
+		idleTimeout: idleTimeout,
+		done:        make(chan struct{}),
+		byAddr:      make(map[string]*udpConnEntry),
+		byID:        make(map[uint16]*udpConnEntry),
+	}
+	go t.evictLoop()
+	return t
+}
+
+// idFor returns the connection id for addr, assigning a new one if addr
+// hasn't been seen before, and refreshes its last-used time.
+func (t *udpConnTable) idFor(addr *net.UDPAddr) uint16 {
+	key := addr.String()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e, ok := t.byAddr[key]; ok {
+		e.lastUsed = time.Now()
+		return e.id
+	}
+
+	t.nextID++
+	e := &udpConnEntry{id: t.nextID, addr: addr, lastUsed: time.Now()}
+	t.byAddr[key] = e
+	t.byID[e.id] = e
+	return e.id
+}
+
+// addrFor returns the peer address for id, refreshing its last-used time.
+func (t *udpConnTable) addrFor(id uint16) (*net.UDPAddr, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.byID[id]
+	if !ok {
+		return nil, false
+	}
+	e.lastUsed = time.Now()
+	return e.addr, true
+}
+
+func (t *udpConnTable) evictLoop() {
+	ticker := time.NewTicker(t.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case now := <-ticker.C:
+			t.evictOlderThan(now.Add(-t.idleTimeout))
+		}
+	}
+}
+
+func (t *udpConnTable) evictOlderThan(cutoff time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, e := range t.byAddr {
+		if e.lastUsed.Before(cutoff) {
+			delete(t.byAddr, key)
+			delete(t.byID, e.id)
+		}
+	}
+}
+
+// Close stops the table's background eviction goroutine.
+func (t *udpConnTable) Close() {
+	close(t.done)
+}
@@ -0,0 +1,87 @@
+package liveshare
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUDPFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    *net.UDPAddr
+		payload []byte
+	}{
+		{"ipv4", &net.UDPAddr{IP: net.ParseIP("203.0.113.5").To4(), Port: 53}, []byte("hello")},
+		{"ipv6", &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 12345}, []byte{1, 2, 3, 4}},
+		{"empty payload", &net.UDPAddr{IP: net.ParseIP("10.0.0.1").To4(), Port: 9}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeUDPFrame(&buf, 42, tt.addr, tt.payload); err != nil {
+				t.Fatalf("writeUDPFrame: %v", err)
+			}
+
+			id, payload, err := readUDPFrame(&buf)
+			if err != nil {
+				t.Fatalf("readUDPFrame: %v", err)
+			}
+			if id != 42 {
+				t.Errorf("id = %d, want 42", id)
+			}
+			if !bytes.Equal(payload, tt.payload) {
+				t.Errorf("payload = %v, want %v", payload, tt.payload)
+			}
+		})
+	}
+}
+
+func TestReadUDPFrameTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write([]byte{0, 1, 0}) // declares a 1-byte body, too short to hold the id and address family
+
+	if _, _, err := readUDPFrame(&buf); err == nil {
+		t.Fatal("expected an error for a truncated frame")
+	}
+}
+
+func TestUDPConnTableAssignsStableIDs(t *testing.T) {
+	table := newUDPConnTable(time.Hour)
+	defer table.Close()
+
+	a := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1111}
+	b := &net.UDPAddr{IP: net.ParseIP("192.0.2.2"), Port: 2222}
+
+	idA1 := table.idFor(a)
+	idB := table.idFor(b)
+	idA2 := table.idFor(a)
+
+	if idA1 != idA2 {
+		t.Errorf("idFor(a) = %d then %d, want a stable id", idA1, idA2)
+	}
+	if idA1 == idB {
+		t.Errorf("idFor(a) and idFor(b) both = %d, want distinct ids", idA1)
+	}
+
+	got, ok := table.addrFor(idA1)
+	if !ok || got.String() != a.String() {
+		t.Errorf("addrFor(%d) = %v, %v, want %v, true", idA1, got, ok, a)
+	}
+}
+
+func TestUDPConnTableEvictsIdleEntries(t *testing.T) {
+	table := newUDPConnTable(time.Millisecond)
+	defer table.Close()
+
+	a := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1111}
+	id := table.idFor(a)
+
+	table.evictOlderThan(time.Now().Add(time.Hour)) // evict everything
+
+	if _, ok := table.addrFor(id); ok {
+		t.Fatal("expected the entry to have been evicted")
+	}
+}